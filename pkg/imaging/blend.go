@@ -0,0 +1,309 @@
+package imaging
+
+import "math"
+
+func clamp255(v float64) float64 {
+	return math.Min(math.Max(v, 0), 255)
+}
+
+// porterDuff builds an OverlayOp that implements the Porter-Duff compositing
+// model aO = aS*Fa + aD*Fb, where Fa and Fb are the per-operator alpha
+// coefficients as functions of the source and destination alpha (both in the
+// 0..1 range). Colors are composited in premultiplied space and then
+// unpremultiplied back to the straight NRGBA values the rest of the package
+// works with.
+func porterDuff(Fa, Fb func(as, ad float64) float64) OverlayOp {
+	return func(r1, g1, b1, a1, r2, g2, b2, a2 float64) (r, g, b, a float64) {
+		as := a2 / 255
+		ad := a1 / 255
+		fa := Fa(as, ad)
+		fb := Fb(as, ad)
+		ao := as*fa + ad*fb
+		if ao <= 0 {
+			return 0, 0, 0, 0
+		}
+		csr, csg, csb := r2*as, g2*as, b2*as
+		cdr, cdg, cdb := r1*ad, g1*ad, b1*ad
+		r = clamp255((csr*fa + cdr*fb) / ao)
+		g = clamp255((csg*fa + cdg*fb) / ao)
+		b = clamp255((csb*fa + cdb*fb) / ao)
+		a = clamp255(ao * 255)
+		return
+	}
+}
+
+// Porter-Duff compositing operators. Src refers to img, Dst refers to
+// background, matching the operand order of OverlayWithOp.
+var (
+	OpSrcOver = porterDuff(
+		func(as, ad float64) float64 { return 1 },
+		func(as, ad float64) float64 { return 1 - as },
+	)
+	OpDstOver = porterDuff(
+		func(as, ad float64) float64 { return 1 - ad },
+		func(as, ad float64) float64 { return 1 },
+	)
+	OpSrcIn = porterDuff(
+		func(as, ad float64) float64 { return ad },
+		func(as, ad float64) float64 { return 0 },
+	)
+	OpDstIn = porterDuff(
+		func(as, ad float64) float64 { return 0 },
+		func(as, ad float64) float64 { return as },
+	)
+	OpSrcOut = porterDuff(
+		func(as, ad float64) float64 { return 1 - ad },
+		func(as, ad float64) float64 { return 0 },
+	)
+	OpDstOut = porterDuff(
+		func(as, ad float64) float64 { return 0 },
+		func(as, ad float64) float64 { return 1 - as },
+	)
+	OpSrcAtop = porterDuff(
+		func(as, ad float64) float64 { return ad },
+		func(as, ad float64) float64 { return 1 - as },
+	)
+	OpDstAtop = porterDuff(
+		func(as, ad float64) float64 { return 1 - ad },
+		func(as, ad float64) float64 { return as },
+	)
+	OpXor = porterDuff(
+		func(as, ad float64) float64 { return 1 - ad },
+		func(as, ad float64) float64 { return 1 - as },
+	)
+	OpClear = porterDuff(
+		func(as, ad float64) float64 { return 0 },
+		func(as, ad float64) float64 { return 0 },
+	)
+)
+
+// separableBlend builds an OverlayOp from a per-channel blend function B,
+// following the standard (SVG/PDF) separable blend-mode compositing formula:
+//
+//	Co = (1-aS)*Cd + (1-aD)*Cs + aS*aD*B(Cs/aS, Cd/aD)
+//
+// where Cs and Cd are the premultiplied source/destination colors; the
+// result is composited with normal (SrcOver) alpha and unpremultiplied back
+// to a straight color.
+func separableBlend(B func(cs, cd float64) float64) OverlayOp {
+	return func(r1, g1, b1, a1, r2, g2, b2, a2 float64) (r, g, b, a float64) {
+		as := a2 / 255
+		ad := a1 / 255
+		ao := as + ad*(1-as)
+		if ao <= 0 {
+			return 0, 0, 0, 0
+		}
+		blend := func(s1, s2 float64) float64 {
+			cs := s2 / 255
+			cd := s1 / 255
+			c := (1-as)*ad*cd + (1-ad)*as*cs + as*ad*B(cs, cd)
+			return clamp255(c * 255 / ao)
+		}
+		r = blend(r1, r2)
+		g = blend(g1, g2)
+		b = blend(b1, b2)
+		a = clamp255(ao * 255)
+		return
+	}
+}
+
+func blendMultiply(cs, cd float64) float64 {
+	return cs * cd
+}
+
+func blendScreen(cs, cd float64) float64 {
+	return cs + cd - cs*cd
+}
+
+func blendHardLight(cs, cd float64) float64 {
+	if cs <= 0.5 {
+		return 2 * cs * cd
+	}
+	return 1 - 2*(1-cs)*(1-cd)
+}
+
+func blendOverlay(cs, cd float64) float64 {
+	return blendHardLight(cd, cs)
+}
+
+func blendSoftLightD(cd float64) float64 {
+	if cd <= 0.25 {
+		return ((16*cd-12)*cd + 4) * cd
+	}
+	return math.Sqrt(cd)
+}
+
+func blendSoftLight(cs, cd float64) float64 {
+	if cs <= 0.5 {
+		return cd - (1-2*cs)*cd*(1-cd)
+	}
+	return cd + (2*cs-1)*(blendSoftLightD(cd)-cd)
+}
+
+func blendColorDodge(cs, cd float64) float64 {
+	if cd <= 0 {
+		return 0
+	}
+	if cs >= 1 {
+		return 1
+	}
+	return math.Min(1, cd/(1-cs))
+}
+
+func blendColorBurn(cs, cd float64) float64 {
+	if cd >= 1 {
+		return 1
+	}
+	if cs <= 0 {
+		return 0
+	}
+	return 1 - math.Min(1, (1-cd)/cs)
+}
+
+func blendDifference(cs, cd float64) float64 {
+	return math.Abs(cd - cs)
+}
+
+func blendExclusion(cs, cd float64) float64 {
+	return cd + cs - 2*cd*cs
+}
+
+// Separable RGB blend modes.
+var (
+	OpMultiply   = separableBlend(blendMultiply)
+	OpScreen     = separableBlend(blendScreen)
+	OpOverlay    = separableBlend(blendOverlay)
+	OpHardLight  = separableBlend(blendHardLight)
+	OpSoftLight  = separableBlend(blendSoftLight)
+	OpColorDodge = separableBlend(blendColorDodge)
+	OpColorBurn  = separableBlend(blendColorBurn)
+	OpDifference = separableBlend(blendDifference)
+	OpExclusion  = separableBlend(blendExclusion)
+)
+
+// rgb is a straight (unpremultiplied, 0..1) color triple, used internally by
+// the non-separable HSL blend modes.
+type rgb struct{ r, g, b float64 }
+
+func (c rgb) lum() float64 {
+	return 0.3*c.r + 0.59*c.g + 0.11*c.b
+}
+
+func (c rgb) min() float64 {
+	return math.Min(c.r, math.Min(c.g, c.b))
+}
+
+func (c rgb) max() float64 {
+	return math.Max(c.r, math.Max(c.g, c.b))
+}
+
+func (c rgb) sat() float64 {
+	return c.max() - c.min()
+}
+
+// clipColor pulls an out-of-gamut color back into [0,1] while preserving its
+// luminosity, per the SVG/PDF blend-mode spec.
+func clipColor(c rgb) rgb {
+	l := c.lum()
+	n := c.min()
+	x := c.max()
+	if n < 0 {
+		c.r = l + (c.r-l)*l/(l-n)
+		c.g = l + (c.g-l)*l/(l-n)
+		c.b = l + (c.b-l)*l/(l-n)
+	}
+	if x > 1 {
+		c.r = l + (c.r-l)*(1-l)/(x-l)
+		c.g = l + (c.g-l)*(1-l)/(x-l)
+		c.b = l + (c.b-l)*(1-l)/(x-l)
+	}
+	return c
+}
+
+func setLum(c rgb, l float64) rgb {
+	d := l - c.lum()
+	c.r += d
+	c.g += d
+	c.b += d
+	return clipColor(c)
+}
+
+func setSat(c rgb, s float64) rgb {
+	channels := [3]*float64{&c.r, &c.g, &c.b}
+	lo, mid, hi := channels[0], channels[1], channels[2]
+	if *lo > *mid {
+		lo, mid = mid, lo
+	}
+	if *mid > *hi {
+		mid, hi = hi, mid
+	}
+	if *lo > *mid {
+		lo, mid = mid, lo
+	}
+	if *hi > *lo {
+		*mid = (*mid - *lo) * s / (*hi - *lo)
+		*hi = s
+	} else {
+		*mid = 0
+		*hi = 0
+	}
+	*lo = 0
+	return c
+}
+
+func blendHue(cb, cs rgb) rgb {
+	return setLum(setSat(cs, cb.sat()), cb.lum())
+}
+
+func blendSaturation(cb, cs rgb) rgb {
+	return setLum(setSat(cb, cs.sat()), cb.lum())
+}
+
+func blendColor(cb, cs rgb) rgb {
+	return setLum(cs, cb.lum())
+}
+
+func blendLuminosity(cb, cs rgb) rgb {
+	return setLum(cb, cs.lum())
+}
+
+// nonSeparableBlend builds an OverlayOp from a whole-color blend function B
+// (the HSL-family modes, which mix channels together and so can't be applied
+// one component at a time). Compositing follows the same formula as
+// separableBlend, just evaluated on the RGB triple as a whole.
+//
+// Per the W3C/PDF blend-mode spec that Lum/Sat/SetLum/SetSat come from, B
+// operates directly on the straight (non-premultiplied) sRGB channel
+// values — the spec itself doesn't linearize them — so there's no
+// gamma-to-linear conversion here despite "linear RGB" sometimes being used
+// loosely to describe this step.
+func nonSeparableBlend(B func(cb, cs rgb) rgb) OverlayOp {
+	return func(r1, g1, b1, a1, r2, g2, b2, a2 float64) (r, g, b, a float64) {
+		as := a2 / 255
+		ad := a1 / 255
+		ao := as + ad*(1-as)
+		if ao <= 0 {
+			return 0, 0, 0, 0
+		}
+		cs := rgb{r2 / 255, g2 / 255, b2 / 255}
+		cd := rgb{r1 / 255, g1 / 255, b1 / 255}
+		blended := B(cd, cs)
+		mix := func(cs, cd, b float64) float64 {
+			c := (1-as)*ad*cd + (1-ad)*as*cs + as*ad*b
+			return clamp255(c * 255 / ao)
+		}
+		r = mix(cs.r, cd.r, blended.r)
+		g = mix(cs.g, cd.g, blended.g)
+		b = mix(cs.b, cd.b, blended.b)
+		a = clamp255(ao * 255)
+		return
+	}
+}
+
+// Non-separable (HSL) Photoshop-style blend modes.
+var (
+	OpHue        = nonSeparableBlend(blendHue)
+	OpSaturation = nonSeparableBlend(blendSaturation)
+	OpColor      = nonSeparableBlend(blendColor)
+	OpLuminosity = nonSeparableBlend(blendLuminosity)
+)
@@ -0,0 +1,157 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// canvasTileSize is the edge length, in pixels, of the square tiles
+// CanvasBuilder renders in parallel.
+const canvasTileSize = 256
+
+type canvasSprite struct {
+	scanner *scanner
+	rect    image.Rectangle
+	op      OverlayOp
+}
+
+// CanvasBuilder accumulates sprite placements and renders them onto a
+// canvas tile-by-tile, blending each sprite with its own OverlayOp, so that
+// stacking hundreds of images never requires cloning the whole background or
+// materializing every input up front. Tiles are blended in parallel using the
+// same goroutine pool as the rest of the package.
+type CanvasBuilder struct {
+	sprites []canvasSprite
+}
+
+// NewCanvasBuilder creates an empty CanvasBuilder.
+func NewCanvasBuilder() *CanvasBuilder {
+	return &CanvasBuilder{}
+}
+
+// Add places img at pt, to be blended with op when the canvas is rendered.
+func (c *CanvasBuilder) Add(img image.Image, pt image.Point, op OverlayOp) {
+	sc := newScanner(img)
+	rect := image.Rectangle{Min: pt, Max: pt.Add(image.Pt(sc.w, sc.h))}
+	c.sprites = append(c.sprites, canvasSprite{scanner: sc, rect: rect, op: op})
+}
+
+// Render fills a new w×h canvas with bg and blends every placed sprite onto
+// it, returning the result.
+func (c *CanvasBuilder) Render(w, h int, bg color.Color) *image.NRGBA {
+	dst := New(w, h, bg)
+	c.RenderTo(dst)
+	return dst
+}
+
+// RenderTo blends every placed sprite onto dst in place, without touching
+// any pixels not covered by a sprite. This lets callers stream tiles
+// directly into a pre-allocated buffer or an animated GIF frame instead of
+// allocating a fresh canvas per Render call.
+func (c *CanvasBuilder) RenderTo(dst draw.Image) {
+	if nrgba, ok := dst.(*image.NRGBA); ok {
+		c.renderToNRGBA(nrgba)
+		return
+	}
+	c.renderToGeneric(dst)
+}
+
+func (c *CanvasBuilder) renderToNRGBA(dst *image.NRGBA) {
+	b := dst.Bounds()
+	if b.Empty() || len(c.sprites) == 0 {
+		return
+	}
+	tilesY := (b.Dy() + canvasTileSize - 1) / canvasTileSize
+	tilesX := (b.Dx() + canvasTileSize - 1) / canvasTileSize
+	parallel(0, tilesY, func(tys <-chan int) {
+		scanLine := make([]uint8, canvasTileSize*4)
+		for ty := range tys {
+			y0 := b.Min.Y + ty*canvasTileSize
+			y1 := y0 + canvasTileSize
+			if y1 > b.Max.Y {
+				y1 = b.Max.Y
+			}
+			for tx := 0; tx < tilesX; tx++ {
+				x0 := b.Min.X + tx*canvasTileSize
+				x1 := x0 + canvasTileSize
+				if x1 > b.Max.X {
+					x1 = b.Max.X
+				}
+				tile := image.Rect(x0, y0, x1, y1)
+				for _, sp := range c.sprites {
+					inter := tile.Intersect(sp.rect)
+					if inter.Empty() {
+						continue
+					}
+					blendTile(dst, sp, inter, scanLine[:inter.Dx()*4])
+				}
+			}
+		}
+	})
+}
+
+// blendTile blends the part of sprite sp covering inter onto dst, using
+// scanLine as scratch space for one row of sprite pixels at a time.
+func blendTile(dst *image.NRGBA, sp canvasSprite, inter image.Rectangle, scanLine []uint8) {
+	var r, g, b, a float64
+	for y := inter.Min.Y; y < inter.Max.Y; y++ {
+		sx1 := inter.Min.X - sp.rect.Min.X
+		sx2 := inter.Max.X - sp.rect.Min.X
+		sy1 := y - sp.rect.Min.Y
+		sy2 := sy1 + 1
+		sp.scanner.scan(sx1, sy1, sx2, sy2, scanLine)
+		i := dst.PixOffset(inter.Min.X, y)
+		j := 0
+		for x := inter.Min.X; x < inter.Max.X; x++ {
+			r1 := float64(dst.Pix[i+0])
+			g1 := float64(dst.Pix[i+1])
+			b1 := float64(dst.Pix[i+2])
+			a1 := float64(dst.Pix[i+3])
+
+			r2 := float64(scanLine[j+0])
+			g2 := float64(scanLine[j+1])
+			b2 := float64(scanLine[j+2])
+			a2 := float64(scanLine[j+3])
+
+			r, g, b, a = sp.op(r1, g1, b1, a1, r2, g2, b2, a2)
+			dst.Pix[i+0] = uint8(r)
+			dst.Pix[i+1] = uint8(g)
+			dst.Pix[i+2] = uint8(b)
+			dst.Pix[i+3] = uint8(a)
+
+			i += 4
+			j += 4
+		}
+	}
+}
+
+// renderToGeneric is the fallback path for draw.Image implementations that
+// aren't *image.NRGBA; it composites through At/Set and so doesn't benefit
+// from tiling or parallelism, but keeps RenderTo usable for any draw.Image.
+func (c *CanvasBuilder) renderToGeneric(dst draw.Image) {
+	for _, sp := range c.sprites {
+		inter := dst.Bounds().Intersect(sp.rect)
+		if inter.Empty() {
+			continue
+		}
+		scanLine := make([]uint8, inter.Dx()*4)
+		for y := inter.Min.Y; y < inter.Max.Y; y++ {
+			sx1 := inter.Min.X - sp.rect.Min.X
+			sx2 := inter.Max.X - sp.rect.Min.X
+			sy1 := y - sp.rect.Min.Y
+			sy2 := sy1 + 1
+			sp.scanner.scan(sx1, sy1, sx2, sy2, scanLine)
+			j := 0
+			for x := inter.Min.X; x < inter.Max.X; x++ {
+				c1 := color.NRGBAModel.Convert(dst.At(x, y)).(color.NRGBA)
+				r, g, b, a := sp.op(
+					float64(c1.R), float64(c1.G), float64(c1.B), float64(c1.A),
+					float64(scanLine[j+0]), float64(scanLine[j+1]), float64(scanLine[j+2]), float64(scanLine[j+3]),
+				)
+				dst.Set(x, y, color.NRGBA{uint8(r), uint8(g), uint8(b), uint8(a)})
+				j += 4
+			}
+		}
+	}
+}
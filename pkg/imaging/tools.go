@@ -2,69 +2,113 @@ package imaging
 
 import (
 	"bytes"
+	"container/heap"
 	"image"
 	"image/color"
 	"math"
-	"sync"
+	"sort"
 )
 
-// OpaqueBounds returns a bounding box for the given image
-func OpaqueBounds(img image.Image, threshold uint8) image.Rectangle {
-	src := newScanner(img)
-	out := image.Rectangle{}
-	first := true
-	dst := image.NewNRGBA(image.Rect(0, 0, src.w, src.h))
-	var mu sync.Mutex
-	parallel(0, src.h, func(ys <-chan int) {
+// opaqueScan produces a single full NRGBA copy of img, which OpaqueBounds,
+// OpaquePolygon, OpaqueHull and OpaqueConcaveHull all read pixel data from
+// instead of each re-scanning the source image.
+func opaqueScan(img image.Image) *image.NRGBA {
+	return Clone(img)
+}
+
+// opaqueBoundsFrom computes the bounding box of pixels with alpha > threshold
+// in an already-scanned image, via a per-row min/max reduction: each worker
+// finds the opaque extent of its own rows with no locking, and the rows are
+// merged into the final rectangle in a single pass afterward.
+//
+// Like the original implementation, the returned rectangle's Max is
+// inclusive: it's the coordinate of the rightmost/bottommost opaque pixel,
+// not one past it, so Dx()/Dy() undercount the opaque span by one. This
+// keeps the contract callers already depend on; rows are merged with the
+// standard exclusive-Max Union internally and corrected by one at the end.
+func opaqueBoundsFrom(dst *image.NRGBA, threshold uint8) image.Rectangle {
+	b := dst.Bounds()
+	if b.Empty() {
+		return image.Rectangle{}
+	}
+	rowBounds := make([]image.Rectangle, b.Dy())
+	parallel(0, b.Dy(), func(ys <-chan int) {
 		for y := range ys {
 			i := y * dst.Stride
-			src.scan(0, y, src.w, y+1, dst.Pix[i:i+src.w*4])
-			for x := 0; x < src.w; x++ {
-				a := dst.Pix[i+3]
-				i += 4
-				if a > threshold {
-					mu.Lock()
-					if first {
-						out.Min = image.Point{x, y}
-						out.Max = out.Min
-						first = false
-					}
-					mu.Unlock()
-				}
-				if a > threshold {
-					mu.Lock()
-					if !first {
-						out.Min.X = int(math.Min(float64(x), float64(out.Min.X)))
-						out.Min.Y = int(math.Min(float64(y), float64(out.Min.Y)))
-						out.Max.X = int(math.Max(float64(x), float64(out.Max.X)))
-						out.Max.Y = int(math.Max(float64(y), float64(out.Max.Y)))
+			minX, maxX := -1, -1
+			for x := 0; x < b.Dx(); x++ {
+				if dst.Pix[i+x*4+3] > threshold {
+					if minX == -1 {
+						minX = x
 					}
-					mu.Unlock()
+					maxX = x
 				}
 			}
+			if minX != -1 {
+				rowBounds[y] = image.Rect(b.Min.X+minX, b.Min.Y+y, b.Min.X+maxX+1, b.Min.Y+y+1)
+			}
 		}
 	})
+	out := image.Rectangle{}
+	first := true
+	for _, r := range rowBounds {
+		if r.Empty() {
+			continue
+		}
+		if first {
+			out = r
+			first = false
+			continue
+		}
+		out = out.Union(r)
+	}
+	if first {
+		return image.Rectangle{}
+	}
+	out.Max.X--
+	out.Max.Y--
 	return out
 }
 
+// OpaqueBounds returns a bounding box for the given image
+func OpaqueBounds(img image.Image, threshold uint8) image.Rectangle {
+	return opaqueBoundsFrom(opaqueScan(img), threshold)
+}
+
+// OpaqueBoundsN returns the opaque bounding box of img, expanded by padding
+// pixels on every side and clamped back to the image bounds.
+func OpaqueBoundsN(img image.Image, threshold uint8, padding int) image.Rectangle {
+	dst := opaqueScan(img)
+	b := opaqueBoundsFrom(dst, threshold)
+	// b's Max is inclusive, so a region one pixel wide or tall gives an Empty
+	// rectangle; only the zero rectangle without an opaque pixel at (0, 0)
+	// means there is nothing to pad.
+	if padding == 0 || b == (image.Rectangle{}) && (len(dst.Pix) < 4 || dst.Pix[3] <= threshold) {
+		return b
+	}
+	return b.Inset(-padding).Intersect(img.Bounds())
+}
+
 // OpaquePolygon returns a bounding polygon for the given image
 func OpaquePolygon(img image.Image, n int, threshold uint8) (out []image.Point) {
-	bounds := OpaqueBounds(img, threshold)
-	src := newScanner(img)
-	dst := image.NewNRGBA(image.Rect(0, 0, src.w, src.h))
+	dst := opaqueScan(img)
+	bounds := opaqueBoundsFrom(dst, threshold)
 	out = make([]image.Point, 2*n)
 	var (
 		pointsLeft  = out[:n]
 		pointsRight = out[n : 2*n]
 	)
 	yStep := float64(bounds.Dy()-1) / float64(n-1)
-	w := bounds.Dx()
 	// Left, Right
+	//
+	// i is advanced *before* dst.Pix[i+3] is read below, matching the
+	// original per-row-scan implementation's indexing exactly (it reads one
+	// column to the right of x), so this refactor to the shared opaqueScan
+	// cache doesn't shift the sampled silhouette.
 	parallel(0, n, func(ks <-chan int) {
 		for k := range ks {
 			y := int(math.Floor(float64(bounds.Min.Y) + float64(k)*yStep))
-			i := (y - bounds.Min.Y) * 4 * w
-			src.scan(bounds.Min.X, y, bounds.Max.X, y+1, dst.Pix[i:i+w*4])
+			i := y*dst.Stride + bounds.Min.X*4
 			foundLeft := false
 			for x := bounds.Min.X; x < bounds.Max.X; x++ {
 				i += 4
@@ -83,8 +127,319 @@ func OpaquePolygon(img image.Image, n int, threshold uint8) (out []image.Point)
 			}
 		}
 	})
-	// h := bounds.Dy()
-	// xMinStep := 3.0
+	return out
+}
+
+// extractOpaquePoints returns every pixel in an already-scanned image whose
+// alpha is above threshold. OpaqueHull builds on this single-pass extraction
+// instead of re-scanning the image itself; OpaqueConcaveHull uses
+// extractBoundaryPoints instead.
+func extractOpaquePoints(dst *image.NRGBA, threshold uint8) []image.Point {
+	b := dst.Bounds()
+	var pts []image.Point
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := y * dst.Stride
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if dst.Pix[i+3] > threshold {
+				pts = append(pts, image.Pt(x, y))
+			}
+			i += 4
+		}
+	}
+	return pts
+}
+
+// extractBoundaryPoints returns the silhouette of an already-scanned image:
+// for every row, the leftmost and rightmost pixel with alpha above
+// threshold, and for every column, the topmost and bottommost such pixel
+// (deduplicated). This is the set OpaqueConcaveHull walks — tracing a
+// concave hull over every interior pixel of a filled shape makes the walk
+// wander inward instead of following the outline, and is far more points
+// than a k-NN walk needs.
+func extractBoundaryPoints(dst *image.NRGBA, threshold uint8) []image.Point {
+	b := dst.Bounds()
+	if b.Empty() {
+		return nil
+	}
+	seen := make(map[image.Point]bool)
+	var pts []image.Point
+	add := func(p image.Point) {
+		if !seen[p] {
+			seen[p] = true
+			pts = append(pts, p)
+		}
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := y * dst.Stride
+		left, right := -1, -1
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if dst.Pix[i+3] > threshold {
+				if left == -1 {
+					left = x
+				}
+				right = x
+			}
+			i += 4
+		}
+		if left != -1 {
+			add(image.Pt(left, y))
+			add(image.Pt(right, y))
+		}
+	}
+	for x := b.Min.X; x < b.Max.X; x++ {
+		top, bottom := -1, -1
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			if dst.Pix[y*dst.Stride+x*4+3] > threshold {
+				if top == -1 {
+					top = y
+				}
+				bottom = y
+			}
+		}
+		if top != -1 {
+			add(image.Pt(x, top))
+			add(image.Pt(x, bottom))
+		}
+	}
+	return pts
+}
+
+func crossProduct(o, a, b image.Point) int {
+	return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+}
+
+// OpaqueHull returns the convex hull of every pixel in img with alpha above
+// threshold, computed with Andrew's monotone chain algorithm in O(n log n).
+func OpaqueHull(img image.Image, threshold uint8) []image.Point {
+	return convexHull(extractOpaquePoints(opaqueScan(img), threshold))
+}
+
+func convexHull(pts []image.Point) []image.Point {
+	if len(pts) < 3 {
+		out := make([]image.Point, len(pts))
+		copy(out, pts)
+		return out
+	}
+
+	sorted := make([]image.Point, len(pts))
+	copy(sorted, pts)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].X != sorted[j].X {
+			return sorted[i].X < sorted[j].X
+		}
+		return sorted[i].Y < sorted[j].Y
+	})
+
+	n := len(sorted)
+	hull := make([]image.Point, 0, 2*n)
+
+	// Lower hull.
+	for _, p := range sorted {
+		for len(hull) >= 2 && crossProduct(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+
+	// Upper hull.
+	lower := len(hull) + 1
+	for i := n - 2; i >= 0; i-- {
+		p := sorted[i]
+		for len(hull) >= lower && crossProduct(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+
+	return hull[:len(hull)-1]
+}
+
+// OpaqueConcaveHull returns a concave hull of the silhouette of img (its
+// per-row and per-column opaque extents, not every interior pixel; see
+// extractBoundaryPoints) with alpha above threshold, using the
+// k-nearest-neighbors concave hull algorithm (Moreira & Santos): starting
+// from the lowest point, it repeatedly walks to the unvisited point among
+// its k nearest neighbors that represents the largest right turn and
+// doesn't cross an already-drawn edge, terminating once the walk returns to
+// the start. Lower k traces a tighter, more concave outline; higher k tends
+// toward the convex hull. If every neighbor at the current k would cross an
+// existing edge, k is grown (as in the source algorithm) until one doesn't
+// or the remaining point set is exhausted, in which case the walk falls
+// back to the nearest remaining point and the result may have a
+// self-intersecting edge at that step.
+func OpaqueConcaveHull(img image.Image, threshold uint8, k int) []image.Point {
+	return concaveHull(extractBoundaryPoints(opaqueScan(img), threshold), k)
+}
+
+func concaveHull(pts []image.Point, k int) []image.Point {
+	if len(pts) < 3 {
+		out := make([]image.Point, len(pts))
+		copy(out, pts)
+		return out
+	}
+	if k < 3 {
+		k = 3
+	}
+	if k > len(pts)-1 {
+		k = len(pts) - 1
+	}
+
+	start := pts[0]
+	for _, p := range pts[1:] {
+		if p.Y < start.Y || (p.Y == start.Y && p.X < start.X) {
+			start = p
+		}
+	}
+
+	remaining := removePoint(pts, start)
+	hull := []image.Point{start}
+	current := start
+	prevAngle := 0.0
+
+	for len(remaining) > 0 {
+		candidates := remaining
+		if len(hull) >= 3 {
+			candidates = append(append([]image.Point{}, remaining...), start)
+		}
+		next := selectNext(current, candidates, hull, prevAngle, k)
+
+		prevAngle = math.Atan2(float64(next.Y-current.Y), float64(next.X-current.X))
+		hull = append(hull, next)
+		current = next
+		if next == start {
+			break
+		}
+		remaining = removePoint(remaining, next)
+	}
+
+	return hull
+}
+
+// selectNext picks the candidate to walk to next: among the kStart nearest
+// candidates to current, the one representing the largest right turn from
+// prevAngle that doesn't cross an existing hull edge. If none of those
+// qualify, k is grown and the search retried, up to the full candidate set;
+// if that still finds nothing, the single nearest candidate is returned so
+// the walk always terminates.
+func selectNext(current image.Point, candidates, hull []image.Point, prevAngle float64, kStart int) image.Point {
+	for k := kStart; k <= len(candidates); k++ {
+		neighbors := nearestPoints(candidates, current, k)
+		sort.Slice(neighbors, func(i, j int) bool {
+			return rightTurnAngle(prevAngle, current, neighbors[i]) > rightTurnAngle(prevAngle, current, neighbors[j])
+		})
+		for _, cand := range neighbors {
+			if !segmentCrossesHull(current, cand, hull) {
+				return cand
+			}
+		}
+	}
+	return nearestPoints(candidates, current, 1)[0]
+}
+
+// nearestPoints returns the k points in pts closest to from, by squared
+// Euclidean distance, using a bounded max-heap so finding them is O(n log k)
+// instead of sorting the whole point set.
+func nearestPoints(pts []image.Point, from image.Point, k int) []image.Point {
+	if k > len(pts) {
+		k = len(pts)
+	}
+	if k <= 0 {
+		return nil
+	}
+	h := make(nearestPointHeap, 0, k)
+	for _, p := range pts {
+		dx, dy := p.X-from.X, p.Y-from.Y
+		distSq := dx*dx + dy*dy
+		if len(h) < k {
+			heap.Push(&h, pointDist{distSq, p})
+			continue
+		}
+		if distSq < h[0].distSq {
+			heap.Pop(&h)
+			heap.Push(&h, pointDist{distSq, p})
+		}
+	}
+	out := make([]image.Point, len(h))
+	for i, pd := range h {
+		out[i] = pd.pt
+	}
+	return out
+}
+
+// pointDist pairs a point with its squared distance to a fixed reference
+// point, for use in nearestPointHeap.
+type pointDist struct {
+	distSq int
+	pt     image.Point
+}
+
+// nearestPointHeap is a max-heap of pointDist ordered by distSq, so the
+// farthest of the k points kept so far is always at the root and can be
+// evicted in O(log k) when a closer point is found.
+type nearestPointHeap []pointDist
+
+func (h nearestPointHeap) Len() int            { return len(h) }
+func (h nearestPointHeap) Less(i, j int) bool  { return h[i].distSq > h[j].distSq }
+func (h nearestPointHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *nearestPointHeap) Push(x interface{}) { *h = append(*h, x.(pointDist)) }
+func (h *nearestPointHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// rightTurnAngle measures, in [0, 2*Pi), how sharp a clockwise turn it is
+// from the incoming direction prevAngle to the direction from current to
+// candidate. Larger is a sharper right turn.
+func rightTurnAngle(prevAngle float64, current, candidate image.Point) float64 {
+	angle := math.Atan2(float64(candidate.Y-current.Y), float64(candidate.X-current.X))
+	turn := prevAngle - angle
+	for turn < 0 {
+		turn += 2 * math.Pi
+	}
+	for turn >= 2*math.Pi {
+		turn -= 2 * math.Pi
+	}
+	return turn
+}
+
+// segmentCrossesHull reports whether the segment a-b properly intersects any
+// edge of the hull walked so far, ignoring edges that already share an
+// endpoint with a or b.
+func segmentCrossesHull(a, b image.Point, hull []image.Point) bool {
+	for i := 0; i < len(hull)-1; i++ {
+		e1, e2 := hull[i], hull[i+1]
+		if e1 == a || e2 == a || e1 == b || e2 == b {
+			continue
+		}
+		if segmentsIntersect(a, b, e1, e2) {
+			return true
+		}
+	}
+	return false
+}
+
+func segmentsIntersect(p1, p2, p3, p4 image.Point) bool {
+	d1 := crossProduct(p3, p4, p1)
+	d2 := crossProduct(p3, p4, p2)
+	d3 := crossProduct(p1, p2, p3)
+	d4 := crossProduct(p1, p2, p4)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+// removePoint returns a copy of pts with the first occurrence of p removed.
+func removePoint(pts []image.Point, p image.Point) []image.Point {
+	out := make([]image.Point, 0, len(pts))
+	removed := false
+	for _, q := range pts {
+		if !removed && q == p {
+			removed = true
+			continue
+		}
+		out = append(out, q)
+	}
 	return out
 }
 